@@ -2,41 +2,421 @@ package main
 
 import (
 	"fmt"
-	"net"
+	"strconv"
+	"strings"
 
 	"github.com/lightningnetwork/lnd/uspv"
 	"github.com/lightningnetwork/lnd/uspv/uwire"
+	"github.com/roasbeef/btcd/wire"
 )
 
-func PushChannel(args []string) error {
-	if RemoteCon == nil {
-		return fmt.Errorf("Not connected to anyone, can't push\n")
+// SCon is this node's wallet/channel state.  RemoteCon is whichever peer
+// the CLI is currently pointed at, for the single-peer commands (push,
+// break, open, close, ...) that don't take a peer argument of their own.
+// CnMap tracks every live connection by peer id, so inbound messages can
+// be answered on the connection they actually arrived on instead of
+// whatever RemoteCon happens to be at the time.
+var (
+	SCon      *uspv.SPVCon
+	RemoteCon *uspv.LNDConn
+	CnMap     = make(map[[16]byte]*uspv.LNDConn)
+)
+
+func init() {
+	var err error
+	SCon, err = uspv.NewSPVCon()
+	if err != nil {
+		panic(err)
 	}
+}
 
-	//	fmt.Printf("push %d to (%d,%d)\n", peerIdx, cIdx, amt)
+// init registers one handler per msgid with the uwire dispatch table.
+// Adding a new message type now takes a uwire.Message implementation in
+// its own file plus a RegisterHandler call here, instead of another branch
+// in OmniHandler.
+func init() {
+	uwire.RegisterHandler(uwire.MSGID_TEXTCHAT, handleTextChat)
+	uwire.RegisterHandler(uwire.MSGID_PUBREQ, handlePubReq)
+	uwire.RegisterHandler(uwire.MSGID_PUBRESP, handlePubResp)
+	uwire.RegisterHandler(uwire.MSGID_MULTIDESC, handleMultiDesc)
+	uwire.RegisterHandler(uwire.MSGID_MULTIACK, handleMultiAck)
+	uwire.RegisterHandler(uwire.MSGID_CLOSEREQ, handleCloseReq)
+	uwire.RegisterHandler(uwire.MSGID_CLOSERESP, handleCloseResp)
+	uwire.RegisterHandler(uwire.MSGID_SIGPUSH, handleSigPush)
+	uwire.RegisterHandler(uwire.MSGID_SIGREV, handleSigRev)
+}
 
+// sendToPeer writes m to the live connection for peer, instead of
+// whatever RemoteCon currently points at.  Every reply to an inbound
+// message should go through this, not RemoteCon directly, since with more
+// than one peer connected RemoteCon isn't necessarily the one who sent us
+// the message we're replying to.
+func sendToPeer(peer [16]byte, m uwire.Message) error {
+	conn, ok := CnMap[peer]
+	if !ok {
+		return fmt.Errorf("no open connection to peer %x", peer)
+	}
+	return uwire.WriteMessage(conn, m)
+}
+
+func handleTextChat(from [16]byte, m uwire.Message) error {
+	tc := m.(*uwire.TextChat)
+	fmt.Printf("text from %x: %s\n", from, tc.Text)
 	return nil
 }
 
-// PushChannel pushes money to the other side of the channel.  It
-// creates a sigpush message and sends that to the peer
-func PushSig(peerIdx, cIdx uint32, amt int64) error {
+func handlePubReq(from [16]byte, m uwire.Message) error {
+	fmt.Printf("got pubkey req from %x\n", from)
+	return PubReqHandler(from)
+}
+
+func handlePubResp(from [16]byte, m uwire.Message) error {
+	fmt.Printf("got pubkey response from %x\n", from)
+	return PubRespHandler(from, m.(*uwire.PubResp))
+}
+
+func handleMultiDesc(from [16]byte, m uwire.Message) error {
+	fmt.Printf("Got multisig description from %x\n", from)
+	return QChanDescHandler(from, m.(*uwire.MultiDesc))
+}
+
+func handleMultiAck(from [16]byte, m uwire.Message) error {
+	fmt.Printf("Got multisig ack from %x\n", from)
+	return QChanAckHandler(from, m.(*uwire.MultiAck))
+}
+
+func handleCloseReq(from [16]byte, m uwire.Message) error {
+	fmt.Printf("Got close request from %x\n", from)
+	return CloseReqHandler(from, m.(*uwire.CloseReq))
+}
+
+func handleCloseResp(from [16]byte, m uwire.Message) error {
+	fmt.Printf("Got close response from %x\n", from)
+	return CloseRespHandler(from, m.(*uwire.CloseResp))
+}
+
+func handleSigPush(from [16]byte, m uwire.Message) error {
+	fmt.Printf("Got sigpush from %x\n", from)
+	PullSig(from, m.(*uwire.SigPush))
+	return nil
+}
+
+func handleSigRev(from [16]byte, m uwire.Message) error {
+	fmt.Printf("Got sigrev from %x\n", from)
+	SigRevHandler(from, m.(*uwire.SigRev))
+	return nil
+}
+
+// Say sends a free-form text message to RemoteCon.
+func Say(args []string) error {
 	if RemoteCon == nil {
-		return fmt.Errorf("Not connected to anyone, can't push\n")
+		return fmt.Errorf("not connected to anyone, can't talk")
 	}
+	return uwire.WriteMessage(RemoteCon, uwire.NewTextChat(strings.Join(args, " ")))
+}
 
-	fmt.Printf("push %d to (%d,%d)\n", peerIdx, cIdx, amt)
+// RequestPub asks RemoteCon to send back its node pubkey.
+func RequestPub(args []string) error {
+	if RemoteCon == nil {
+		return fmt.Errorf("not connected to anyone, can't request a pubkey")
+	}
+	return uwire.WriteMessage(RemoteCon, uwire.NewPubReq())
+}
 
+// PubReqHandler answers an incoming PubReq with our node pubkey.
+func PubReqHandler(from [16]byte) error {
+	var pub [33]byte
+	copy(pub[:], SCon.NodePub.SerializeCompressed())
+	return sendToPeer(from, uwire.NewPubResp(pub))
+}
+
+// PubRespHandler logs the node pubkey a peer announced to us.  Nothing
+// downstream consumes it yet: a MultiDesc carries the sender's channel
+// pubkey directly, and a MultiAck carries the responder's back, so opening
+// a channel doesn't actually need this announced ahead of time.
+func PubRespHandler(from [16]byte, pr *uwire.PubResp) error {
+	fmt.Printf("%x announced pubkey %x\n", from, pr.PubKey)
 	return nil
 }
 
-//func PullSig(from [16]byte, sigpushBytes []byte) {
+// OpenChannel proposes a new channel to RemoteCon over an already-funded
+// multisig outpoint: args are txid, vout, capAmt and initPay (how much of
+// capAmt we're paying them as an opening balance).  Finding and
+// broadcasting the funding tx itself is the wallet's job, not this one.
+func OpenChannel(args []string) error {
+	if RemoteCon == nil {
+		return fmt.Errorf("not connected to anyone, can't open a channel")
+	}
+	if len(args) < 4 {
+		return fmt.Errorf("need args: open txid vout capAmt initPay")
+	}
+
+	op, err := parseOutPointArgs(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	capAmt, err := strconv.Atoi(args[2])
+	if err != nil {
+		return err
+	}
+	initPay, err := strconv.Atoi(args[3])
+	if err != nil {
+		return err
+	}
+
+	peerIdx, err := SCon.TS.GetPeerIdx(RemoteCon.RemotePub)
+	if err != nil {
+		return err
+	}
+
+	qc, err := SCon.TS.NewQchan(peerIdx, op, int64(capAmt), int64(initPay))
+	if err != nil {
+		return err
+	}
+
+	var pub [33]byte
+	copy(pub[:], qc.MyPub.SerializeCompressed())
+
+	return uwire.WriteMessage(RemoteCon,
+		uwire.NewMultiDesc(op, int64(capAmt), int64(initPay), pub))
+}
+
+// QChanDescHandler processes an incoming MultiDesc: it derives the new
+// channel, signs our half of the initial commitment, and replies with a
+// MultiAck carrying our own channel pubkey and that signature.
+func QChanDescHandler(from [16]byte, md *uwire.MultiDesc) error {
+	peerIdx, err := SCon.TS.GetPeerIdxByID(from)
+	if err != nil {
+		return err
+	}
+
+	qc, sig, err := SCon.TS.OpenQchan(peerIdx, md.Outpoint, md.CapAmt, md.InitPay, md.PubKey)
+	if err != nil {
+		return err
+	}
+
+	var pub [33]byte
+	copy(pub[:], qc.MyPub.SerializeCompressed())
+
+	return sendToPeer(from, uwire.NewMultiAck(md.Outpoint, pub, sig))
+}
+
+// QChanAckHandler processes the counterparty's MultiAck, finishing the
+// channel open.
+func QChanAckHandler(from [16]byte, ma *uwire.MultiAck) error {
+	qc, err := SCon.TS.GetQchanByOutPoint(ma.Outpoint)
+	if err != nil {
+		return err
+	}
+	return SCon.TS.AckQchan(qc.PeerIdx, qc.KeyIdx, ma.PubKey, ma.Signature)
+}
+
+// CloseChannel proposes a cooperative close of channel (peerIdx, cIdx),
+// paying out the current state.
+func CloseChannel(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("need args: close peerIdx cIdx")
+	}
+	peerIdx, err := strconv.Atoi(args[0])
+	if err != nil {
+		return err
+	}
+	cIdx, err := strconv.Atoi(args[1])
+	if err != nil {
+		return err
+	}
+
+	qc, err := SCon.TS.GetQchan(uint32(peerIdx), uint32(cIdx))
+	if err != nil {
+		return err
+	}
+
+	sig, err := SCon.TS.SignCloseTx(qc)
+	if err != nil {
+		return err
+	}
+
+	return sendToPeer(qc.PeerID, uwire.NewCloseReq(qc.Op, sig))
+}
+
+// CloseReqHandler processes an incoming cooperative close proposal: it
+// verifies the requester's signature, countersigns, replies with a
+// CloseResp, and queues the close tx for broadcast.
+func CloseReqHandler(from [16]byte, cr *uwire.CloseReq) error {
+	qc, err := SCon.TS.GetQchanByOutPoint(cr.Outpoint)
+	if err != nil {
+		return err
+	}
+	if err := SCon.TS.VerifyCloseSig(qc, cr.Signature); err != nil {
+		return err
+	}
+
+	sig, err := SCon.TS.SignCloseTx(qc)
+	if err != nil {
+		return err
+	}
+	if err := sendToPeer(from, uwire.NewCloseResp(qc.Op, sig)); err != nil {
+		return err
+	}
+
+	tx, err := SCon.TS.FinishCloseTx(qc, cr.Signature)
+	if err != nil {
+		return err
+	}
+	return SCon.NewOutgoingTx(tx)
+}
+
+// CloseRespHandler processes the counterparty's countersignature on a
+// close we proposed, and queues the close tx for broadcast.
+func CloseRespHandler(from [16]byte, cr *uwire.CloseResp) error {
+	qc, err := SCon.TS.GetQchanByOutPoint(cr.Outpoint)
+	if err != nil {
+		return err
+	}
+	if err := SCon.TS.VerifyCloseSig(qc, cr.Signature); err != nil {
+		return err
+	}
+
+	tx, err := SCon.TS.FinishCloseTx(qc, cr.Signature)
+	if err != nil {
+		return err
+	}
+	return SCon.NewOutgoingTx(tx)
+}
+
+// PushChannel is the CLI entrypoint for pushing money to the other side of
+// a channel.  It just parses the peer index, channel index and amount out
+// of args and hands off to PushSig, which does the actual work.
+func PushChannel(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("need args: push peerIdx cIdx amt")
+	}
+
+	peerIdx, err := strconv.Atoi(args[0])
+	if err != nil {
+		return err
+	}
+	cIdx, err := strconv.Atoi(args[1])
+	if err != nil {
+		return err
+	}
+	amt, err := strconv.Atoi(args[2])
+	if err != nil {
+		return err
+	}
+
+	return PushSig(uint32(peerIdx), uint32(cIdx), int64(amt))
+}
+
+// PushSig pushes money to the other side of the channel.  It builds the
+// next commitment transaction spending the channel's multisig outpoint with
+// amt moved from our side to theirs, signs it with our channel key, records
+// the not-yet-acked state as qc's pending state in the in-memory TxStore,
+// and sends a sigpush message to the channel's peer carrying the outpoint,
+// the amount pushed and our signature.  Nothing is written to disk, so the
+// pending state does not survive a restart.
+func PushSig(peerIdx, cIdx uint32, amt int64) error {
+	if amt <= 0 {
+		return fmt.Errorf("can only push positive amounts, got %d", amt)
+	}
+
+	qc, err := SCon.TS.GetQchan(peerIdx, cIdx)
+	if err != nil {
+		return err
+	}
+	if _, ok := CnMap[qc.PeerID]; !ok {
+		return fmt.Errorf("not connected to peer %x, can't push", qc.PeerID)
+	}
+	if amt > qc.State.MyAmt {
+		return fmt.Errorf("push %d exceeds our balance %d on (%d,%d)",
+			amt, qc.State.MyAmt, peerIdx, cIdx)
+	}
+
+	fmt.Printf("push %d to (%d,%d)\n", amt, peerIdx, cIdx)
+
+	// Build and sign the next commitment tx, but leave the committed
+	// state alone until the counterparty has acked it with a sigrev;
+	// until then the new state is only recorded as pending.
+	nextMyAmt := qc.State.MyAmt - amt
+	nextTheirAmt := qc.State.TheirAmt + amt
+
+	sig, err := SCon.TS.SignNextState(qc, nextMyAmt, nextTheirAmt)
+	if err != nil {
+		return err
+	}
+
+	if err := SCon.TS.SavePendingPush(qc, nextMyAmt, nextTheirAmt, sig); err != nil {
+		return err
+	}
+
+	return sendToPeer(qc.PeerID, uwire.NewSigPush(qc.Op, amt, sig))
+}
+
+// PullSig handles an incoming sigpush: the other side has pushed sp.Amount
+// to us.  It verifies their signature against the next commitment state,
+// adopts that state in the in-memory TxStore, and replies with a sigrev
+// carrying the revocation preimage for the state it replaces (so we can
+// prove we won't broadcast the old one), sent back to from specifically,
+// not to whatever RemoteCon currently points at.  Nothing is written to
+// disk, so the adopted state does not survive a restart.
+func PullSig(from [16]byte, sp *uwire.SigPush) {
+	if sp.Amount <= 0 {
+		fmt.Printf("PullSig: %x sent non-positive push amount %d\n", from, sp.Amount)
+		return
+	}
+
+	qc, err := SCon.TS.GetQchanByOutPoint(sp.Outpoint)
+	if err != nil {
+		fmt.Printf("PullSig: %s\n", err.Error())
+		return
+	}
+
+	nextMyAmt := qc.State.MyAmt + sp.Amount
+	nextTheirAmt := qc.State.TheirAmt - sp.Amount
+	if nextTheirAmt < 0 {
+		fmt.Printf("PullSig: %x pushed %d, more than they have\n", from, sp.Amount)
+		return
+	}
+
+	if err := SCon.TS.VerifySigNextState(qc, nextMyAmt, nextTheirAmt, sp.Signature); err != nil {
+		fmt.Printf("PullSig: bad sig from %x: %s\n", from, err.Error())
+		return
+	}
+
+	// AdvanceQchanState does the whole thing -- handing back the
+	// revocation preimage for the state we're leaving, generating a fresh
+	// one for the new state, writing the new balances and sig, and bumping
+	// the state index -- inside one locked step, so no other TxStore call
+	// can see the channel half-updated.
+	rev, err := SCon.TS.AdvanceQchanState(qc, nextMyAmt, nextTheirAmt, sp.Signature)
+	if err != nil {
+		fmt.Printf("PullSig: %s\n", err.Error())
+		return
+	}
+
+	if err := sendToPeer(from, uwire.NewSigRev(qc.Op, rev)); err != nil {
+		fmt.Printf("PullSig: couldn't send sigrev to %x: %s\n", from, err.Error())
+	}
+}
+
+// SigRevHandler handles the sigrev that comes back after a PushSig: the
+// peer has adopted our new commitment state and is handing over the
+// revocation for the one it replaces.  Once this lands we can finally
+// commit to the pending push ourselves.
+func SigRevHandler(from [16]byte, sr *uwire.SigRev) {
+	qc, err := SCon.TS.GetQchanByOutPoint(sr.Outpoint)
+	if err != nil {
+		fmt.Printf("SigRevHandler: %s\n", err.Error())
+		return
+	}
 
-//	return
-//}
+	if err := SCon.TS.CommitPendingPush(qc, sr.Revocation); err != nil {
+		fmt.Printf("SigRevHandler: %s\n", err.Error())
+		return
+	}
 
-//func CloseReqHandler(from [16]byte, reqbytes []byte) {
-// func
+	fmt.Printf("push to %x complete\n", from)
+}
 
 // BreakChannel closes the channel without the other party's involvement.
 // The user causing the channel Break has to wait for the OP_CSV timeout
@@ -59,19 +439,29 @@ func BreakChannel(args []string) error {
 	if err != nil {
 		return err
 	}
-	var opBytes []byte
+	var qc *uspv.Qchan
 	// find the chan we want to close
 	for _, m := range multis {
 		if m.PeerIdx == currentPeerIdx {
-			opBytes = uspv.OutPointToBytes(m.Op)
+			qc = m
 			fmt.Printf("peerIdx %d multIdx %d height %d %s amt: %d\n",
 				m.PeerIdx, m.KeyIdx, m.AtHeight, m.Op.String(), m.Value)
 			break
 		}
 	}
-	opBytes[0] = 0x00
+	if qc == nil {
+		return fmt.Errorf("no channel open with peer %d", currentPeerIdx)
+	}
 
-	return nil
+	// broadcast our latest signed commitment tx; the other side can't
+	// stop us.  The commitment tx built by buildCommitTx has no CSV delay
+	// or revocation script on its outputs.
+	tx, err := SCon.TS.SignedCommitTx(qc)
+	if err != nil {
+		return err
+	}
+
+	return SCon.NewOutgoingTx(tx)
 }
 
 // handles stuff that comes in over the wire.  Not user-initiated.
@@ -84,78 +474,57 @@ func OmniHandler(OmniChan chan []byte) {
 			continue
 		}
 		copy(from[:], newdata[:16])
-		msg := newdata[16:]
-		msgid := msg[0]
 
-		// TEXT MESSAGE.  SIMPLE
-		if msgid == uwire.MSGID_TEXTCHAT { //it's text
-			fmt.Printf("text from %x: %s\n", from, msg[1:])
+		m, err := uwire.DecodeFrame(newdata[16:])
+		if err != nil {
+			fmt.Printf("OmniHandler: %s\n", err.Error())
 			continue
 		}
 
-		// PUBKEY REQUEST
-		if msgid == uwire.MSGID_PUBREQ {
-			fmt.Printf("got pubkey req from %x\n", from)
-			PubReqHandler(from) // goroutine ready
-			continue
-		}
-		// PUBKEY RESPONSE
-		if msgid == uwire.MSGID_PUBRESP {
-			fmt.Printf("got pubkey response from %x\n", from)
-			PubRespHandler(from, msg[1:]) // goroutine ready
-			continue
-		}
-		// MULTISIG DESCTIPTION
-		if msgid == uwire.MSGID_MULTIDESC {
-			fmt.Printf("Got multisig description from %x\n", from)
-			QChanDescHandler(from, msg[1:])
-			continue
-		}
-		// MULTISIG ACK
-		if msgid == uwire.MSGID_MULTIACK {
-			fmt.Printf("Got multisig ack from %x\n", from)
-			QChanAckHandler(from, msg[1:])
-			continue
-		}
-		// CLOSE REQ
-		if msgid == uwire.MSGID_CLOSEREQ {
-			fmt.Printf("Got close request from %x\n", from)
-			CloseReqHandler(from, msg[1:])
-			continue
+		if err := uwire.Dispatch(from, m); err != nil {
+			fmt.Printf("OmniHandler: %s\n", err.Error())
 		}
-		// CLOSE RESP
-		if msgid == uwire.MSGID_CLOSERESP {
-			fmt.Printf("Got close response from %x\n", from)
-			CloseRespHandler(from, msg[1:])
-			continue
-		}
-		fmt.Printf("Unknown message id byte %x", msgid)
-		continue
 	}
 }
 
-// Every lndc has one of these running
-// it listens for incoming messages on the lndc and hands it over
-// to the OmniHandler via omnichan
-func LNDCReceiver(l net.Conn, id [16]byte, OmniChan chan []byte) error {
+// Every lndc has one of these running: it listens for incoming messages on
+// the connection and hands them to OmniHandler via OmniChan, registering
+// the connection in CnMap under the peer's node id so replies can be
+// routed back to them specifically.
+func LNDCReceiver(l *uspv.LNDConn, OmniChan chan []byte) error {
 	// first store peer in DB if not yet known
-	_, err := SCon.TS.NewPeer(RemoteCon.RemotePub)
-	if err != nil {
+	if _, err := SCon.TS.NewPeer(l.RemotePub); err != nil {
 		return err
 	}
+
+	CnMap[l.RemoteLNId] = l
+	defer delete(CnMap, l.RemoteLNId)
+
 	for {
-		msg := make([]byte, 65535)
-		//	fmt.Printf("read message from %x\n", l.RemoteLNId)
-		n, err := l.Read(msg)
+		// ReadFrame blocks until a complete length-prefixed frame has
+		// arrived.  Unlike a bare Read, it doesn't assume a single
+		// message fits inside one TCP segment.
+		frame, err := uwire.ReadFrame(l)
 		if err != nil {
-			fmt.Printf("read error with %x: %s\n",
-				id, err.Error())
-			//			delete(CnMap, id)
+			fmt.Printf("read error with %x: %s\n", l.RemoteLNId, err.Error())
 			return l.Close()
 		}
-		msg = msg[:n]
-		msg = append(id[:], msg...)
+		msg := append(l.RemoteLNId[:], frame...)
 		fmt.Printf("incoming msg %x\n", msg)
 		OmniChan <- msg
 	}
-}
\ No newline at end of file
+}
+
+// parseOutPointArgs parses a txid/vout pair as passed on the CLI into a
+// wire.OutPoint.
+func parseOutPointArgs(txid, vout string) (wire.OutPoint, error) {
+	hash, err := wire.NewShaHashFromStr(txid)
+	if err != nil {
+		return wire.OutPoint{}, err
+	}
+	idx, err := strconv.Atoi(vout)
+	if err != nil {
+		return wire.OutPoint{}, err
+	}
+	return *wire.NewOutPoint(hash, uint32(idx)), nil
+}
@@ -0,0 +1,164 @@
+package uspv
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/roasbeef/btcd/btcec"
+	"github.com/roasbeef/btcd/wire"
+)
+
+func sha256First16(b []byte) [16]byte {
+	h := sha256.Sum256(b)
+	var id [16]byte
+	copy(id[:], h[:16])
+	return id
+}
+
+// canonicalAmts orders (myAmt, theirAmt) by comparing the channel's two
+// pubkeys, so both sides build byte-identical commitment transactions for
+// the same economic state regardless of which one is asking.
+func (qc *Qchan) canonicalAmts(myAmt, theirAmt int64) (int64, int64, error) {
+	if qc.MyPub == nil || qc.TheirPub == nil {
+		return 0, 0, fmt.Errorf("channel (%d,%d) is missing a pubkey", qc.PeerIdx, qc.KeyIdx)
+	}
+	if bytes.Compare(qc.MyPub.SerializeCompressed(), qc.TheirPub.SerializeCompressed()) <= 0 {
+		return myAmt, theirAmt, nil
+	}
+	return theirAmt, myAmt, nil
+}
+
+// buildCommitTx builds the commitment transaction for qc paying myAmt to
+// us and theirAmt to them, spending the channel's multisig outpoint.
+//
+// This doesn't yet carry the full BOLT-style script set (CSV delays,
+// HTLCs) -- it's a single input, two output transaction that gives both
+// sides something concrete to sign and revoke.
+func buildCommitTx(qc *Qchan, myAmt, theirAmt int64) (*wire.MsgTx, error) {
+	amtA, amtB, err := qc.canonicalAmts(myAmt, theirAmt)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := wire.NewMsgTx()
+	tx.AddTxIn(wire.NewTxIn(&qc.Op, nil))
+	tx.AddTxOut(wire.NewTxOut(amtA, nil))
+	tx.AddTxOut(wire.NewTxOut(amtB, nil))
+	return tx, nil
+}
+
+// commitSigHash is the digest the channel key signs over: the sha256 of
+// the serialized commitment tx.
+func commitSigHash(tx *wire.MsgTx) ([32]byte, error) {
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		return [32]byte{}, err
+	}
+	return sha256.Sum256(buf.Bytes()), nil
+}
+
+// SignNextState builds the commitment tx for the proposed next state
+// (myAmt/theirAmt) and signs it with qc's channel key.  It doesn't touch
+// qc.State or qc.Pending -- adopting the new state is a separate step once
+// the other side has acked it.
+func (ts *TxStore) SignNextState(qc *Qchan, myAmt, theirAmt int64) ([]byte, error) {
+	if qc.MyPriv == nil {
+		return nil, fmt.Errorf("channel (%d,%d) has no channel key", qc.PeerIdx, qc.KeyIdx)
+	}
+	tx, err := buildCommitTx(qc, myAmt, theirAmt)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := commitSigHash(tx)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := qc.MyPriv.Sign(hash[:])
+	if err != nil {
+		return nil, err
+	}
+	return sig.Serialize(), nil
+}
+
+// VerifySigNextState checks sig against the commitment tx for the proposed
+// next state, using the counterparty's channel pubkey.
+func (ts *TxStore) VerifySigNextState(qc *Qchan, myAmt, theirAmt int64, sig []byte) error {
+	if qc.TheirPub == nil {
+		return fmt.Errorf("channel (%d,%d) has no counterparty pubkey", qc.PeerIdx, qc.KeyIdx)
+	}
+	parsedSig, err := btcec.ParseDERSignature(sig, btcec.S256())
+	if err != nil {
+		return err
+	}
+	tx, err := buildCommitTx(qc, myAmt, theirAmt)
+	if err != nil {
+		return err
+	}
+	hash, err := commitSigHash(tx)
+	if err != nil {
+		return err
+	}
+	if !parsedSig.Verify(hash[:], qc.TheirPub) {
+		return fmt.Errorf("invalid signature on next state for channel (%d,%d)", qc.PeerIdx, qc.KeyIdx)
+	}
+	return nil
+}
+
+// finishTx builds the commitment tx for (myAmt, theirAmt), signs it with
+// our channel key, and splices in theirSig, ready to broadcast.
+//
+// The scriptSig here is a placeholder (our signature followed by theirs);
+// a real 2-of-2 multisig spend needs a proper redeem script, which this
+// package doesn't construct yet.
+func (ts *TxStore) finishTx(qc *Qchan, myAmt, theirAmt int64, theirSig []byte) (*wire.MsgTx, error) {
+	tx, err := buildCommitTx(qc, myAmt, theirAmt)
+	if err != nil {
+		return nil, err
+	}
+	mySig, err := ts.SignNextState(qc, myAmt, theirAmt)
+	if err != nil {
+		return nil, err
+	}
+	tx.TxIn[0].SignatureScript = append(append([]byte{}, mySig...), theirSig...)
+	return tx, nil
+}
+
+// SignedCommitTx returns qc's current commitment tx, fully signed and
+// ready to broadcast unilaterally -- used by BreakChannel.
+func (ts *TxStore) SignedCommitTx(qc *Qchan) (*wire.MsgTx, error) {
+	if qc.State == nil || qc.State.Sig == nil {
+		return nil, fmt.Errorf("channel (%d,%d) has no countersigned state to break with", qc.PeerIdx, qc.KeyIdx)
+	}
+	return ts.finishTx(qc, qc.State.MyAmt, qc.State.TheirAmt, qc.State.Sig)
+}
+
+// SignCloseTx signs the cooperative close transaction paying out qc's
+// current state.  It's the same transaction shape as a commitment tx --
+// just without a revocable path, since once both sides countersign it
+// there's nothing left to revoke.
+func (ts *TxStore) SignCloseTx(qc *Qchan) ([]byte, error) {
+	if qc.State == nil {
+		return nil, fmt.Errorf("channel (%d,%d) has no state to close with", qc.PeerIdx, qc.KeyIdx)
+	}
+	return ts.SignNextState(qc, qc.State.MyAmt, qc.State.TheirAmt)
+}
+
+// VerifyCloseSig checks sig against the close transaction for qc's current
+// state, using the counterparty's channel pubkey.
+func (ts *TxStore) VerifyCloseSig(qc *Qchan, sig []byte) error {
+	if qc.State == nil {
+		return fmt.Errorf("channel (%d,%d) has no state to close with", qc.PeerIdx, qc.KeyIdx)
+	}
+	return ts.VerifySigNextState(qc, qc.State.MyAmt, qc.State.TheirAmt, sig)
+}
+
+// FinishCloseTx builds the close transaction paying out qc's current
+// state, signs it with our channel key, and splices in theirSig, ready to
+// broadcast.
+func (ts *TxStore) FinishCloseTx(qc *Qchan, theirSig []byte) (*wire.MsgTx, error) {
+	if qc.State == nil {
+		return nil, fmt.Errorf("channel (%d,%d) has no state to close with", qc.PeerIdx, qc.KeyIdx)
+	}
+	return ts.finishTx(qc, qc.State.MyAmt, qc.State.TheirAmt, theirSig)
+}
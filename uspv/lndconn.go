@@ -0,0 +1,17 @@
+package uspv
+
+import (
+	"net"
+
+	"github.com/roasbeef/btcd/btcec"
+)
+
+// LNDConn wraps a raw connection to a single lndc peer together with that
+// peer's pubkey and 16-byte node id, the two things the rest of this
+// package needs to address them by.
+type LNDConn struct {
+	net.Conn
+
+	RemotePub  *btcec.PublicKey
+	RemoteLNId [16]byte
+}
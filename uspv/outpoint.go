@@ -0,0 +1,29 @@
+package uspv
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/roasbeef/btcd/wire"
+)
+
+// OutPointToBytes serializes op as 36 bytes: the 32-byte tx hash followed
+// by the 4-byte little-endian output index.  This is the wire format used
+// by every uwire message that carries a channel's outpoint.
+func OutPointToBytes(op wire.OutPoint) []byte {
+	b := make([]byte, 36)
+	copy(b, op.Hash[:])
+	binary.LittleEndian.PutUint32(b[32:], op.Index)
+	return b
+}
+
+// OutPointFromBytes parses the 36-byte form written by OutPointToBytes.
+func OutPointFromBytes(b []byte) (*wire.OutPoint, error) {
+	if len(b) != 36 {
+		return nil, fmt.Errorf("outpoint needs 36 bytes, got %d", len(b))
+	}
+	var op wire.OutPoint
+	copy(op.Hash[:], b[:32])
+	op.Index = binary.LittleEndian.Uint32(b[32:])
+	return &op, nil
+}
@@ -0,0 +1,51 @@
+package uspv
+
+import (
+	"github.com/roasbeef/btcd/btcec"
+	"github.com/roasbeef/btcd/wire"
+)
+
+// StatCom is one commitment state of a channel: how much each side holds,
+// where we are in the revocation sequence, and (once we have one) the
+// counterparty's signature on the commitment tx that pays this state out.
+type StatCom struct {
+	StateIdx uint64
+	MyAmt    int64
+	TheirAmt int64
+
+	// Sig is the counterparty's signature on the commitment tx paying out
+	// MyAmt/TheirAmt.
+	Sig []byte
+
+	// MyRevPreimage is the preimage we'll reveal once this state is
+	// superseded, proving to the other side that we won't try to
+	// broadcast it later.
+	MyRevPreimage [32]byte
+}
+
+// Qchan is a single off-chain payment channel: a 2-of-2 multisig output
+// plus whatever commitment state has been built on top of it.
+type Qchan struct {
+	PeerIdx  uint32
+	KeyIdx   uint32
+	AtHeight int32
+
+	// PeerID is the node id of the other side of this channel, used to
+	// look up their live connection in CnMap when we need to send them
+	// something.
+	PeerID [16]byte
+
+	Op    wire.OutPoint
+	Value int64
+
+	MyPriv   *btcec.PrivateKey
+	MyPub    *btcec.PublicKey
+	TheirPub *btcec.PublicKey
+
+	State   *StatCom
+	Pending *StatCom
+
+	// TheirRevPreimages accumulates every prior-state revocation preimage
+	// the counterparty has handed us, in the order we received them.
+	TheirRevPreimages [][32]byte
+}
@@ -0,0 +1,46 @@
+package uspv
+
+import (
+	"fmt"
+
+	"github.com/roasbeef/btcd/btcec"
+	"github.com/roasbeef/btcd/wire"
+)
+
+// SPVCon is this node's view of the chain and wallet: TS holds peer and
+// channel state, and outgoing transactions get queued here for broadcast.
+type SPVCon struct {
+	TS *TxStore
+
+	// NodePriv/NodePub identify this node to peers over a PubReq/PubResp
+	// handshake, independent of any particular channel's key.
+	NodePriv *btcec.PrivateKey
+	NodePub  *btcec.PublicKey
+
+	// Outgoing collects transactions queued for broadcast.  This package
+	// doesn't include the p2p/chain-sync layer, so NewOutgoingTx queues
+	// the tx rather than actually relaying it.
+	Outgoing []*wire.MsgTx
+}
+
+// NewSPVCon creates an SPVCon with a fresh TxStore and node keypair.
+func NewSPVCon() (*SPVCon, error) {
+	priv, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		return nil, err
+	}
+	return &SPVCon{
+		TS:       NewTxStore(),
+		NodePriv: priv,
+		NodePub:  priv.PubKey(),
+	}, nil
+}
+
+// NewOutgoingTx queues tx for broadcast to the network.
+func (s *SPVCon) NewOutgoingTx(tx *wire.MsgTx) error {
+	if tx == nil {
+		return fmt.Errorf("can't broadcast a nil tx")
+	}
+	s.Outgoing = append(s.Outgoing, tx)
+	return nil
+}
@@ -0,0 +1,339 @@
+package uspv
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sync"
+
+	"github.com/roasbeef/btcd/btcec"
+	"github.com/roasbeef/btcd/wire"
+)
+
+type qchanKey struct {
+	peerIdx uint32
+	cIdx    uint32
+}
+
+type peerRecord struct {
+	idx uint32
+	id  [16]byte
+	pub *btcec.PublicKey
+}
+
+// TxStore is this node's in-memory record of its peers and channels;
+// nothing in it is written to disk.  Every method that changes channel
+// state makes its changes under the store's lock, so a state transition
+// either lands in full or not at all -- there's no way to observe it
+// half-applied.
+type TxStore struct {
+	mtx sync.Mutex
+
+	peersByIdx map[uint32]*peerRecord
+	peersByID  map[[16]byte]uint32
+	nextPeer   uint32
+
+	qchans   map[qchanKey]*Qchan
+	nextChan uint32
+}
+
+// NewTxStore creates an empty TxStore.
+func NewTxStore() *TxStore {
+	return &TxStore{
+		peersByIdx: make(map[uint32]*peerRecord),
+		peersByID:  make(map[[16]byte]uint32),
+		qchans:     make(map[qchanKey]*Qchan),
+	}
+}
+
+// LNId returns the 16-byte node id for pub: the first 16 bytes of
+// sha256(pubkey).
+func LNId(pub *btcec.PublicKey) [16]byte {
+	return sha256First16(pub.SerializeCompressed())
+}
+
+// NewPeer registers a not-yet-seen peer and returns the index we'll refer
+// to them by from now on.  If pub is already known, it returns their
+// existing index.
+func (ts *TxStore) NewPeer(pub *btcec.PublicKey) (uint32, error) {
+	ts.mtx.Lock()
+	defer ts.mtx.Unlock()
+
+	id := LNId(pub)
+	if idx, ok := ts.peersByID[id]; ok {
+		return idx, nil
+	}
+
+	idx := ts.nextPeer
+	ts.nextPeer++
+	ts.peersByIdx[idx] = &peerRecord{idx: idx, id: id, pub: pub}
+	ts.peersByID[id] = idx
+	return idx, nil
+}
+
+// GetPeerIdx looks up the index we've assigned pub.
+func (ts *TxStore) GetPeerIdx(pub *btcec.PublicKey) (uint32, error) {
+	ts.mtx.Lock()
+	defer ts.mtx.Unlock()
+
+	idx, ok := ts.peersByID[LNId(pub)]
+	if !ok {
+		return 0, fmt.Errorf("no peer known for that pubkey")
+	}
+	return idx, nil
+}
+
+// GetPeerID returns the node id we track peerIdx under.
+func (ts *TxStore) GetPeerID(peerIdx uint32) ([16]byte, error) {
+	ts.mtx.Lock()
+	defer ts.mtx.Unlock()
+
+	p, ok := ts.peersByIdx[peerIdx]
+	if !ok {
+		return [16]byte{}, fmt.Errorf("no peer at index %d", peerIdx)
+	}
+	return p.id, nil
+}
+
+// GetPeerIdxByID looks up the index we've assigned the peer with node id
+// id.
+func (ts *TxStore) GetPeerIdxByID(id [16]byte) (uint32, error) {
+	ts.mtx.Lock()
+	defer ts.mtx.Unlock()
+
+	idx, ok := ts.peersByID[id]
+	if !ok {
+		return 0, fmt.Errorf("no peer known for id %x", id)
+	}
+	return idx, nil
+}
+
+// GetAllQchans returns every channel this node currently has open, in no
+// particular order.
+func (ts *TxStore) GetAllQchans() ([]*Qchan, error) {
+	ts.mtx.Lock()
+	defer ts.mtx.Unlock()
+
+	qcs := make([]*Qchan, 0, len(ts.qchans))
+	for _, qc := range ts.qchans {
+		qcs = append(qcs, qc)
+	}
+	return qcs, nil
+}
+
+// GetQchan looks up a channel by the local (peerIdx, cIdx) pair it was
+// opened under.
+func (ts *TxStore) GetQchan(peerIdx, cIdx uint32) (*Qchan, error) {
+	ts.mtx.Lock()
+	defer ts.mtx.Unlock()
+
+	qc, ok := ts.qchans[qchanKey{peerIdx, cIdx}]
+	if !ok {
+		return nil, fmt.Errorf("no channel (%d,%d)", peerIdx, cIdx)
+	}
+	return qc, nil
+}
+
+// GetQchanByOutPoint looks up a channel by its multisig outpoint, which is
+// what incoming push/close messages identify it by.
+func (ts *TxStore) GetQchanByOutPoint(op wire.OutPoint) (*Qchan, error) {
+	ts.mtx.Lock()
+	defer ts.mtx.Unlock()
+
+	for _, qc := range ts.qchans {
+		if qc.Op == op {
+			return qc, nil
+		}
+	}
+	return nil, fmt.Errorf("no channel open on %s", op.String())
+}
+
+// newQchan generates a fresh per-channel key, builds a Qchan for the
+// already-funded multisig outpoint op with the given opening balance
+// split, and stores it, returning the new channel.  theirPub may be nil if
+// the counterparty hasn't derived their own channel key yet -- as is the
+// case for the initiator, who has to send a MultiDesc before the responder
+// has anything to hand back.
+func (ts *TxStore) newQchan(peerIdx uint32, op wire.OutPoint, capAmt, myAmt, theirAmt int64, theirPub *btcec.PublicKey) (*Qchan, error) {
+	ts.mtx.Lock()
+	peer, ok := ts.peersByIdx[peerIdx]
+	if !ok {
+		ts.mtx.Unlock()
+		return nil, fmt.Errorf("no peer at index %d", peerIdx)
+	}
+	cIdx := ts.nextChan
+	ts.nextChan++
+	ts.mtx.Unlock()
+
+	myPriv, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		return nil, err
+	}
+
+	preimage, err := randPreimage()
+	if err != nil {
+		return nil, err
+	}
+
+	qc := &Qchan{
+		PeerIdx:  peerIdx,
+		KeyIdx:   cIdx,
+		PeerID:   peer.id,
+		Op:       op,
+		Value:    capAmt,
+		MyPriv:   myPriv,
+		MyPub:    myPriv.PubKey(),
+		TheirPub: theirPub,
+		State: &StatCom{
+			MyAmt:         myAmt,
+			TheirAmt:      theirAmt,
+			MyRevPreimage: preimage,
+		},
+	}
+
+	ts.mtx.Lock()
+	ts.qchans[qchanKey{peerIdx, cIdx}] = qc
+	ts.mtx.Unlock()
+
+	return qc, nil
+}
+
+// NewQchan is the channel-open initiator's side: it derives and stores the
+// new channel, with myAmt/theirAmt split as capAmt-initPay/initPay (initPay
+// being how much of capAmt we're paying the other side as their opening
+// balance), and returns it so the caller can announce its channel pubkey
+// in the MultiDesc it sends.  The responder's channel pubkey isn't known
+// yet -- it comes back in their MultiAck -- so the new Qchan can't be
+// signed against until AckQchan fills it in.
+func (ts *TxStore) NewQchan(peerIdx uint32, op wire.OutPoint, capAmt, initPay int64) (*Qchan, error) {
+	return ts.newQchan(peerIdx, op, capAmt, capAmt-initPay, initPay, nil)
+}
+
+// OpenQchan derives a new channel from an incoming MultiDesc: op is the
+// already-funded multisig outpoint, capAmt/theirPay are the channel
+// capacity and the portion of it the other side is paying in as our
+// opening balance, and theirPub is the channel pubkey they announced for
+// it. It generates our own channel key, signs the initial commitment, and
+// returns the new channel along with that signature for the MultiAck.
+func (ts *TxStore) OpenQchan(peerIdx uint32, op wire.OutPoint, capAmt, theirPay int64, theirPub [33]byte) (*Qchan, []byte, error) {
+	pub, err := btcec.ParsePubKey(theirPub[:], btcec.S256())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	qc, err := ts.newQchan(peerIdx, op, capAmt, theirPay, capAmt-theirPay, pub)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sig, err := ts.SignNextState(qc, qc.State.MyAmt, qc.State.TheirAmt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return qc, sig, nil
+}
+
+// AckQchan processes the responder's MultiAck for channel (peerIdx, cIdx):
+// it fills in the responder's channel pubkey (only just learned, since
+// they had nothing to announce before deriving the channel themselves),
+// verifies their countersignature against it, and records the signed
+// state, finishing the open.
+func (ts *TxStore) AckQchan(peerIdx, cIdx uint32, theirPub [33]byte, sig []byte) error {
+	pub, err := btcec.ParsePubKey(theirPub[:], btcec.S256())
+	if err != nil {
+		return err
+	}
+
+	ts.mtx.Lock()
+	defer ts.mtx.Unlock()
+
+	qc, ok := ts.qchans[qchanKey{peerIdx, cIdx}]
+	if !ok {
+		return fmt.Errorf("no channel (%d,%d)", peerIdx, cIdx)
+	}
+
+	// VerifySigNextState needs TheirPub set to build the commitment tx;
+	// the old value goes back if their signature doesn't check out.
+	oldPub := qc.TheirPub
+	qc.TheirPub = pub
+	if err := ts.VerifySigNextState(qc, qc.State.MyAmt, qc.State.TheirAmt, sig); err != nil {
+		qc.TheirPub = oldPub
+		return err
+	}
+
+	qc.State.Sig = sig
+	return nil
+}
+
+// SavePendingPush records that we've sent (or are about to send) a sigpush
+// proposing myAmt/theirAmt with sig, without touching the committed state.
+// If the sigrev never comes back, PushSig can just be called again --
+// Pending just gets overwritten with the same values.
+func (ts *TxStore) SavePendingPush(qc *Qchan, myAmt, theirAmt int64, sig []byte) error {
+	ts.mtx.Lock()
+	defer ts.mtx.Unlock()
+
+	qc.Pending = &StatCom{
+		StateIdx: qc.State.StateIdx + 1,
+		MyAmt:    myAmt,
+		TheirAmt: theirAmt,
+		Sig:      sig,
+	}
+	return nil
+}
+
+// AdvanceQchanState is called on the receiving end of a sigpush.  In one
+// locked step it takes the revocation preimage of the state we're leaving,
+// replaces qc.State with the new (myAmt, theirAmt, sig) under a freshly
+// generated preimage, bumps the state index, and returns the old preimage.
+// If generating the new preimage fails, qc.State is left as it was.
+func (ts *TxStore) AdvanceQchanState(qc *Qchan, myAmt, theirAmt int64, sig []byte) ([32]byte, error) {
+	ts.mtx.Lock()
+	defer ts.mtx.Unlock()
+
+	rev := qc.State.MyRevPreimage
+
+	newState := &StatCom{
+		StateIdx: qc.State.StateIdx + 1,
+		MyAmt:    myAmt,
+		TheirAmt: theirAmt,
+		Sig:      sig,
+	}
+	preimage, err := randPreimage()
+	if err != nil {
+		return [32]byte{}, err
+	}
+	newState.MyRevPreimage = preimage
+
+	qc.State = newState
+	return rev, nil
+}
+
+// CommitPendingPush is called on the pushing side once the sigrev comes
+// back: it stashes the peer's revocation for their prior state, adopts the
+// pending state as current under a freshly generated revocation preimage
+// of our own, and clears Pending.
+func (ts *TxStore) CommitPendingPush(qc *Qchan, rev [32]byte) error {
+	ts.mtx.Lock()
+	defer ts.mtx.Unlock()
+
+	if qc.Pending == nil {
+		return fmt.Errorf("channel (%d,%d) has no pending push to commit", qc.PeerIdx, qc.KeyIdx)
+	}
+
+	preimage, err := randPreimage()
+	if err != nil {
+		return err
+	}
+
+	qc.TheirRevPreimages = append(qc.TheirRevPreimages, rev)
+	qc.State = qc.Pending
+	qc.State.MyRevPreimage = preimage
+	qc.Pending = nil
+	return nil
+}
+
+func randPreimage() ([32]byte, error) {
+	var p [32]byte
+	_, err := rand.Read(p[:])
+	return p, err
+}
@@ -0,0 +1,60 @@
+package uwire
+
+import (
+	"io"
+
+	"github.com/lightningnetwork/lnd/uspv"
+	"github.com/roasbeef/btcd/wire"
+)
+
+// CloseReq proposes a cooperative close of the channel at Outpoint,
+// carrying the requester's signature on the proposed close transaction.
+type CloseReq struct {
+	Outpoint  wire.OutPoint
+	Signature []byte
+}
+
+// NewCloseReq creates a new CloseReq message.
+func NewCloseReq(op wire.OutPoint, sig []byte) *CloseReq {
+	return &CloseReq{Outpoint: op, Signature: sig}
+}
+
+// A compile time check to ensure CloseReq implements the uwire.Message
+// interface.
+var _ Message = (*CloseReq)(nil)
+
+// MsgType returns the integer uniquely identifying this message type on
+// the wire.
+func (c *CloseReq) MsgType() uint8 { return MSGID_CLOSEREQ }
+
+// Decode deserializes a serialized CloseReq message from r.
+func (c *CloseReq) Decode(r io.Reader) error {
+	opBytes := make([]byte, 36)
+	if _, err := io.ReadFull(r, opBytes); err != nil {
+		return err
+	}
+	op, err := uspv.OutPointFromBytes(opBytes)
+	if err != nil {
+		return err
+	}
+	c.Outpoint = *op
+
+	sig, err := readVarBytes(r)
+	if err != nil {
+		return err
+	}
+	c.Signature = sig
+	return nil
+}
+
+// Encode serializes the target CloseReq into w.
+func (c *CloseReq) Encode(w io.Writer) error {
+	if _, err := w.Write(uspv.OutPointToBytes(c.Outpoint)); err != nil {
+		return err
+	}
+	return writeVarBytes(w, c.Signature)
+}
+
+func init() {
+	registerType(MSGID_CLOSEREQ, func() Message { return new(CloseReq) })
+}
@@ -0,0 +1,61 @@
+package uwire
+
+import (
+	"io"
+
+	"github.com/lightningnetwork/lnd/uspv"
+	"github.com/roasbeef/btcd/wire"
+)
+
+// CloseResp countersigns a CloseReq, handing back the responder's
+// signature on the same proposed close transaction so either side can
+// broadcast it.
+type CloseResp struct {
+	Outpoint  wire.OutPoint
+	Signature []byte
+}
+
+// NewCloseResp creates a new CloseResp message.
+func NewCloseResp(op wire.OutPoint, sig []byte) *CloseResp {
+	return &CloseResp{Outpoint: op, Signature: sig}
+}
+
+// A compile time check to ensure CloseResp implements the uwire.Message
+// interface.
+var _ Message = (*CloseResp)(nil)
+
+// MsgType returns the integer uniquely identifying this message type on
+// the wire.
+func (c *CloseResp) MsgType() uint8 { return MSGID_CLOSERESP }
+
+// Decode deserializes a serialized CloseResp message from r.
+func (c *CloseResp) Decode(r io.Reader) error {
+	opBytes := make([]byte, 36)
+	if _, err := io.ReadFull(r, opBytes); err != nil {
+		return err
+	}
+	op, err := uspv.OutPointFromBytes(opBytes)
+	if err != nil {
+		return err
+	}
+	c.Outpoint = *op
+
+	sig, err := readVarBytes(r)
+	if err != nil {
+		return err
+	}
+	c.Signature = sig
+	return nil
+}
+
+// Encode serializes the target CloseResp into w.
+func (c *CloseResp) Encode(w io.Writer) error {
+	if _, err := w.Write(uspv.OutPointToBytes(c.Outpoint)); err != nil {
+		return err
+	}
+	return writeVarBytes(w, c.Signature)
+}
+
+func init() {
+	registerType(MSGID_CLOSERESP, func() Message { return new(CloseResp) })
+}
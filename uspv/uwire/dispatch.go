@@ -0,0 +1,35 @@
+package uwire
+
+import "fmt"
+
+// HandlerFunc processes a decoded Message received from peer.
+type HandlerFunc func(peer [16]byte, m Message) error
+
+var (
+	factories = make(map[uint8]func() Message)
+	handlers  = make(map[uint8]HandlerFunc)
+)
+
+// registerType records the zero-value constructor for msgType so the
+// framing layer can allocate something to Decode into.  Every concrete
+// Message in this package calls this from its own init().
+func registerType(msgType uint8, newMsg func() Message) {
+	factories[msgType] = newMsg
+}
+
+// RegisterHandler wires up the function that should run whenever a message
+// of msgType arrives over an LNDC connection.  Callers register one
+// handler per msgid (see main's init in this repo); OmniHandler just looks
+// the handler up via Dispatch instead of running an if/else chain.
+func RegisterHandler(msgType uint8, fn HandlerFunc) {
+	handlers[msgType] = fn
+}
+
+// Dispatch looks up the handler registered for m.MsgType() and invokes it.
+func Dispatch(peer [16]byte, m Message) error {
+	fn, ok := handlers[m.MsgType()]
+	if !ok {
+		return fmt.Errorf("uwire: no handler registered for msgid %x", m.MsgType())
+	}
+	return fn(peer, m)
+}
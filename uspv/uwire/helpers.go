@@ -0,0 +1,37 @@
+package uwire
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// writeVarBytes writes a 2-byte big-endian length prefix followed by b.
+// It's used for the variable-length fields (signatures, chat text) that
+// show up across several message types in this package.
+func writeVarBytes(w io.Writer, b []byte) error {
+	if len(b) > 1<<16-1 {
+		return fmt.Errorf("uwire: %d bytes too long for a varBytes field", len(b))
+	}
+
+	var lenBytes [2]byte
+	binary.BigEndian.PutUint16(lenBytes[:], uint16(len(b)))
+	if _, err := w.Write(lenBytes[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// readVarBytes reads back a slice written by writeVarBytes.
+func readVarBytes(r io.Reader) ([]byte, error) {
+	var lenBytes [2]byte
+	if _, err := io.ReadFull(r, lenBytes[:]); err != nil {
+		return nil, err
+	}
+	b := make([]byte, binary.BigEndian.Uint16(lenBytes[:]))
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,35 @@
+package uwire
+
+import "io"
+
+// Message id bytes identifying the payload that follows a frame's length
+// prefix.  Adding a new message type means adding one file that defines a
+// Message implementation and registering its handler in an init() --
+// nothing else in the package needs to change.
+const (
+	MSGID_TEXTCHAT  uint8 = 0x01
+	MSGID_PUBREQ    uint8 = 0x10
+	MSGID_PUBRESP   uint8 = 0x11
+	MSGID_MULTIDESC uint8 = 0x20
+	MSGID_MULTIACK  uint8 = 0x21
+	MSGID_CLOSEREQ  uint8 = 0x22
+	MSGID_CLOSERESP uint8 = 0x23
+	MSGID_SIGPUSH   uint8 = 0x30
+	MSGID_SIGREV    uint8 = 0x31
+)
+
+// Message is implemented by every payload exchanged between two lndc
+// peers.  It mirrors lnwire.Message, minus the protocol-version plumbing
+// that side needs and this one doesn't (yet).
+type Message interface {
+	// MsgType returns the msgid byte identifying this message on the wire.
+	MsgType() uint8
+
+	// Decode reads the body of the message -- everything after the msgid
+	// byte -- from r.
+	Decode(r io.Reader) error
+
+	// Encode writes the body of the message -- everything after the
+	// msgid byte -- to w.
+	Encode(w io.Writer) error
+}
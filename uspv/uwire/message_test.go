@@ -0,0 +1,86 @@
+package uwire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/roasbeef/btcd/wire"
+)
+
+// roundTripCases lists one populated instance of every concrete Message in
+// this package; TestMessageRoundTrip encodes and decodes each one and
+// checks it comes back unchanged.
+var roundTripCases = []Message{
+	NewTextChat("hello there"),
+	NewPubReq(),
+	NewPubResp([33]byte{0x02, 0x03, 0x04}),
+	NewMultiDesc(wire.OutPoint{Index: 1}, 100000, 40000, [33]byte{0x02, 0x03}),
+	NewMultiAck(wire.OutPoint{Index: 1}, [33]byte{0x02, 0x05}, []byte{0xde, 0xad, 0xbe, 0xef}),
+	NewCloseReq(wire.OutPoint{Index: 2}, []byte{0x01, 0x02}),
+	NewCloseResp(wire.OutPoint{Index: 2}, []byte{0x03, 0x04}),
+	NewSigPush(wire.OutPoint{Index: 3}, 5000, []byte{0x05, 0x06}),
+	NewSigRev(wire.OutPoint{Index: 3}, [32]byte{0x07, 0x08}),
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	for _, want := range roundTripCases {
+		var buf bytes.Buffer
+		if err := want.Encode(&buf); err != nil {
+			t.Fatalf("%T: Encode failed: %v", want, err)
+		}
+
+		got := factories[want.MsgType()]()
+		if err := got.Decode(&buf); err != nil {
+			t.Fatalf("%T: Decode failed: %v", want, err)
+		}
+
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("%T round trip mismatch: want %+v, got %+v", want, want, got)
+		}
+	}
+}
+
+func TestDecodeFrameUnknownMsgID(t *testing.T) {
+	if _, err := DecodeFrame([]byte{0xff}); err == nil {
+		t.Fatal("expected error decoding an unknown msgid, got nil")
+	}
+}
+
+func TestWriteReadFrame(t *testing.T) {
+	var buf bytes.Buffer
+	want := NewTextChat("round trip over the wire")
+	if err := WriteMessage(&buf, want); err != nil {
+		t.Fatalf("WriteMessage failed: %v", err)
+	}
+
+	frame, err := ReadFrame(&buf)
+	if err != nil {
+		t.Fatalf("ReadFrame failed: %v", err)
+	}
+
+	got, err := DecodeFrame(frame)
+	if err != nil {
+		t.Fatalf("DecodeFrame failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("frame round trip mismatch: want %+v, got %+v", want, got)
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	var got *TextChat
+	RegisterHandler(MSGID_TEXTCHAT, func(peer [16]byte, m Message) error {
+		got = m.(*TextChat)
+		return nil
+	})
+
+	want := NewTextChat("dispatched")
+	if err := Dispatch([16]byte{}, want); err != nil {
+		t.Fatalf("Dispatch failed: %v", err)
+	}
+	if got != want {
+		t.Errorf("handler did not receive the dispatched message")
+	}
+}
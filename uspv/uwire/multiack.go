@@ -0,0 +1,70 @@
+package uwire
+
+import (
+	"io"
+
+	"github.com/lightningnetwork/lnd/uspv"
+	"github.com/roasbeef/btcd/wire"
+)
+
+// MultiAck acknowledges a MultiDesc, handing back the responder's channel
+// pubkey (which doesn't exist until the responder derives the channel from
+// the MultiDesc) along with its signature on the initial commitment
+// transaction, so the channel can be considered open.
+type MultiAck struct {
+	Outpoint  wire.OutPoint
+	PubKey    [33]byte
+	Signature []byte
+}
+
+// NewMultiAck creates a new MultiAck message.
+func NewMultiAck(op wire.OutPoint, pubKey [33]byte, sig []byte) *MultiAck {
+	return &MultiAck{Outpoint: op, PubKey: pubKey, Signature: sig}
+}
+
+// A compile time check to ensure MultiAck implements the uwire.Message
+// interface.
+var _ Message = (*MultiAck)(nil)
+
+// MsgType returns the integer uniquely identifying this message type on
+// the wire.
+func (c *MultiAck) MsgType() uint8 { return MSGID_MULTIACK }
+
+// Decode deserializes a serialized MultiAck message from r.
+func (c *MultiAck) Decode(r io.Reader) error {
+	opBytes := make([]byte, 36)
+	if _, err := io.ReadFull(r, opBytes); err != nil {
+		return err
+	}
+	op, err := uspv.OutPointFromBytes(opBytes)
+	if err != nil {
+		return err
+	}
+	c.Outpoint = *op
+
+	if _, err := io.ReadFull(r, c.PubKey[:]); err != nil {
+		return err
+	}
+
+	sig, err := readVarBytes(r)
+	if err != nil {
+		return err
+	}
+	c.Signature = sig
+	return nil
+}
+
+// Encode serializes the target MultiAck into w.
+func (c *MultiAck) Encode(w io.Writer) error {
+	if _, err := w.Write(uspv.OutPointToBytes(c.Outpoint)); err != nil {
+		return err
+	}
+	if _, err := w.Write(c.PubKey[:]); err != nil {
+		return err
+	}
+	return writeVarBytes(w, c.Signature)
+}
+
+func init() {
+	registerType(MSGID_MULTIACK, func() Message { return new(MultiAck) })
+}
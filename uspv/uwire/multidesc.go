@@ -0,0 +1,76 @@
+package uwire
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/lightningnetwork/lnd/uspv"
+	"github.com/roasbeef/btcd/wire"
+)
+
+// MultiDesc describes a freshly broadcast multisig funding output to the
+// other side of a prospective channel, so they can derive the same
+// channel without having seen the funding tx themselves.
+type MultiDesc struct {
+	Outpoint wire.OutPoint
+	CapAmt   int64
+	InitPay  int64
+	PubKey   [33]byte
+}
+
+// NewMultiDesc creates a new MultiDesc message.
+func NewMultiDesc(op wire.OutPoint, capAmt, initPay int64, pubKey [33]byte) *MultiDesc {
+	return &MultiDesc{Outpoint: op, CapAmt: capAmt, InitPay: initPay, PubKey: pubKey}
+}
+
+// A compile time check to ensure MultiDesc implements the uwire.Message
+// interface.
+var _ Message = (*MultiDesc)(nil)
+
+// MsgType returns the integer uniquely identifying this message type on
+// the wire.
+func (c *MultiDesc) MsgType() uint8 { return MSGID_MULTIDESC }
+
+// Decode deserializes a serialized MultiDesc message from r.
+func (c *MultiDesc) Decode(r io.Reader) error {
+	opBytes := make([]byte, 36)
+	if _, err := io.ReadFull(r, opBytes); err != nil {
+		return err
+	}
+	op, err := uspv.OutPointFromBytes(opBytes)
+	if err != nil {
+		return err
+	}
+	c.Outpoint = *op
+
+	var amtBytes [16]byte
+	if _, err := io.ReadFull(r, amtBytes[:]); err != nil {
+		return err
+	}
+	c.CapAmt = int64(binary.BigEndian.Uint64(amtBytes[:8]))
+	c.InitPay = int64(binary.BigEndian.Uint64(amtBytes[8:]))
+
+	_, err = io.ReadFull(r, c.PubKey[:])
+	return err
+}
+
+// Encode serializes the target MultiDesc into w.
+func (c *MultiDesc) Encode(w io.Writer) error {
+	if _, err := w.Write(uspv.OutPointToBytes(c.Outpoint)); err != nil {
+		return err
+	}
+
+	var amtBytes [16]byte
+	binary.BigEndian.PutUint64(amtBytes[:8], uint64(c.CapAmt))
+	binary.BigEndian.PutUint64(amtBytes[8:], uint64(c.InitPay))
+	if _, err := w.Write(amtBytes[:]); err != nil {
+		return err
+	}
+
+	_, err := w.Write(c.PubKey[:])
+	return err
+}
+
+func init() {
+	registerType(MSGID_MULTIDESC, func() Message { return new(MultiDesc) })
+}
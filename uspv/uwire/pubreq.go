@@ -0,0 +1,30 @@
+package uwire
+
+import "io"
+
+// PubReq asks the peer to send back its node pubkey.  It carries no
+// payload; receiving one with the right msgid is the whole message.
+type PubReq struct{}
+
+// NewPubReq creates a new PubReq message.
+func NewPubReq() *PubReq {
+	return &PubReq{}
+}
+
+// A compile time check to ensure PubReq implements the uwire.Message
+// interface.
+var _ Message = (*PubReq)(nil)
+
+// MsgType returns the integer uniquely identifying this message type on
+// the wire.
+func (c *PubReq) MsgType() uint8 { return MSGID_PUBREQ }
+
+// Decode deserializes a serialized PubReq message from r.
+func (c *PubReq) Decode(r io.Reader) error { return nil }
+
+// Encode serializes the target PubReq into w.
+func (c *PubReq) Encode(w io.Writer) error { return nil }
+
+func init() {
+	registerType(MSGID_PUBREQ, func() Message { return new(PubReq) })
+}
@@ -0,0 +1,37 @@
+package uwire
+
+import "io"
+
+// PubResp answers a PubReq with the sender's node pubkey.
+type PubResp struct {
+	PubKey [33]byte
+}
+
+// NewPubResp creates a new PubResp message.
+func NewPubResp(pubKey [33]byte) *PubResp {
+	return &PubResp{PubKey: pubKey}
+}
+
+// A compile time check to ensure PubResp implements the uwire.Message
+// interface.
+var _ Message = (*PubResp)(nil)
+
+// MsgType returns the integer uniquely identifying this message type on
+// the wire.
+func (c *PubResp) MsgType() uint8 { return MSGID_PUBRESP }
+
+// Decode deserializes a serialized PubResp message from r.
+func (c *PubResp) Decode(r io.Reader) error {
+	_, err := io.ReadFull(r, c.PubKey[:])
+	return err
+}
+
+// Encode serializes the target PubResp into w.
+func (c *PubResp) Encode(w io.Writer) error {
+	_, err := w.Write(c.PubKey[:])
+	return err
+}
+
+func init() {
+	registerType(MSGID_PUBRESP, func() Message { return new(PubResp) })
+}
@@ -0,0 +1,75 @@
+package uwire
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/lightningnetwork/lnd/uspv"
+	"github.com/roasbeef/btcd/wire"
+)
+
+// SigPush is sent by the paying side of a channel after it signs a new
+// commitment transaction moving Amount satoshis to the other party.
+type SigPush struct {
+	Outpoint  wire.OutPoint
+	Amount    int64
+	Signature []byte
+}
+
+// NewSigPush creates a new SigPush message.
+func NewSigPush(op wire.OutPoint, amt int64, sig []byte) *SigPush {
+	return &SigPush{Outpoint: op, Amount: amt, Signature: sig}
+}
+
+// A compile time check to ensure SigPush implements the uwire.Message
+// interface.
+var _ Message = (*SigPush)(nil)
+
+// MsgType returns the integer uniquely identifying this message type on
+// the wire.
+func (c *SigPush) MsgType() uint8 { return MSGID_SIGPUSH }
+
+// Decode deserializes a serialized SigPush message from r.
+func (c *SigPush) Decode(r io.Reader) error {
+	opBytes := make([]byte, 36)
+	if _, err := io.ReadFull(r, opBytes); err != nil {
+		return err
+	}
+	op, err := uspv.OutPointFromBytes(opBytes)
+	if err != nil {
+		return err
+	}
+	c.Outpoint = *op
+
+	var amtBytes [8]byte
+	if _, err := io.ReadFull(r, amtBytes[:]); err != nil {
+		return err
+	}
+	c.Amount = int64(binary.BigEndian.Uint64(amtBytes[:]))
+
+	sig, err := readVarBytes(r)
+	if err != nil {
+		return err
+	}
+	c.Signature = sig
+	return nil
+}
+
+// Encode serializes the target SigPush into w.
+func (c *SigPush) Encode(w io.Writer) error {
+	if _, err := w.Write(uspv.OutPointToBytes(c.Outpoint)); err != nil {
+		return err
+	}
+
+	var amtBytes [8]byte
+	binary.BigEndian.PutUint64(amtBytes[:], uint64(c.Amount))
+	if _, err := w.Write(amtBytes[:]); err != nil {
+		return err
+	}
+
+	return writeVarBytes(w, c.Signature)
+}
+
+func init() {
+	registerType(MSGID_SIGPUSH, func() Message { return new(SigPush) })
+}
@@ -0,0 +1,57 @@
+package uwire
+
+import (
+	"io"
+
+	"github.com/lightningnetwork/lnd/uspv"
+	"github.com/roasbeef/btcd/wire"
+)
+
+// SigRev acknowledges a SigPush: it adopts the new commitment state and
+// hands back the revocation preimage for the prior state it replaces.
+type SigRev struct {
+	Outpoint   wire.OutPoint
+	Revocation [32]byte
+}
+
+// NewSigRev creates a new SigRev message.
+func NewSigRev(op wire.OutPoint, rev [32]byte) *SigRev {
+	return &SigRev{Outpoint: op, Revocation: rev}
+}
+
+// A compile time check to ensure SigRev implements the uwire.Message
+// interface.
+var _ Message = (*SigRev)(nil)
+
+// MsgType returns the integer uniquely identifying this message type on
+// the wire.
+func (c *SigRev) MsgType() uint8 { return MSGID_SIGREV }
+
+// Decode deserializes a serialized SigRev message from r.
+func (c *SigRev) Decode(r io.Reader) error {
+	opBytes := make([]byte, 36)
+	if _, err := io.ReadFull(r, opBytes); err != nil {
+		return err
+	}
+	op, err := uspv.OutPointFromBytes(opBytes)
+	if err != nil {
+		return err
+	}
+	c.Outpoint = *op
+
+	_, err = io.ReadFull(r, c.Revocation[:])
+	return err
+}
+
+// Encode serializes the target SigRev into w.
+func (c *SigRev) Encode(w io.Writer) error {
+	if _, err := w.Write(uspv.OutPointToBytes(c.Outpoint)); err != nil {
+		return err
+	}
+	_, err := w.Write(c.Revocation[:])
+	return err
+}
+
+func init() {
+	registerType(MSGID_SIGREV, func() Message { return new(SigRev) })
+}
@@ -0,0 +1,41 @@
+package uwire
+
+import "io"
+
+// TextChat is a free-form text message sent between two peers.  It exists
+// mostly for manually exercising the wire layer.
+type TextChat struct {
+	Text string
+}
+
+// NewTextChat creates a new TextChat message.
+func NewTextChat(text string) *TextChat {
+	return &TextChat{Text: text}
+}
+
+// A compile time check to ensure TextChat implements the uwire.Message
+// interface.
+var _ Message = (*TextChat)(nil)
+
+// MsgType returns the integer uniquely identifying this message type on
+// the wire.
+func (c *TextChat) MsgType() uint8 { return MSGID_TEXTCHAT }
+
+// Decode deserializes a serialized TextChat message from r.
+func (c *TextChat) Decode(r io.Reader) error {
+	text, err := readVarBytes(r)
+	if err != nil {
+		return err
+	}
+	c.Text = string(text)
+	return nil
+}
+
+// Encode serializes the target TextChat into w.
+func (c *TextChat) Encode(w io.Writer) error {
+	return writeVarBytes(w, []byte(c.Text))
+}
+
+func init() {
+	registerType(MSGID_TEXTCHAT, func() Message { return new(TextChat) })
+}